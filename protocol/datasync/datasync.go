@@ -0,0 +1,305 @@
+// Package datasync wraps retransmitted payloads in small MVDS-style group
+// records (https://specs.vac.dev/specs/mvds/) so that a message keeps being
+// retransmitted until its recipient(s) acknowledge it, instead of being
+// fired once over Whisper/Waku and forgotten. The first send of a tracked
+// payload is not wrapped; only Retransmit and ack flushes post groups.
+package datasync
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/status-im/status-go/eth-node/types"
+)
+
+// DefaultAckFlushInterval is how often acks queued via QueueAck, but not yet
+// piggy-backed on a Retransmit, are flushed on their own.
+const DefaultAckFlushInterval = 300 * time.Millisecond
+
+// DefaultMaxRetries bounds how many times a record is retransmitted before
+// it's given up on; callers that need it delivered regardless should
+// re-queue it themselves once it's gone.
+const DefaultMaxRetries = 20
+
+// group is the wire format for a batch of offers/acks sent on one topic.
+// There is no protocol/protobuf message for this yet, so it's encoded as
+// JSON rather than inventing a protobuf type this package can't generate.
+type group struct {
+	Offers []offer  `json:"offers,omitempty"`
+	Acks   [][]byte `json:"acks,omitempty"`
+}
+
+// offer is a single payload pending acknowledgement, identified by a
+// content-derived message ID (see contentMessageID) that stays constant
+// across every retransmit of the same record -- unlike the envelope hash
+// Transport.api.Post returns, which is different on every send.
+type offer struct {
+	MessageID []byte `json:"messageId"`
+	Payload   []byte `json:"payload"`
+}
+
+func marshalGroup(g *group) ([]byte, error) {
+	return json.Marshal(g)
+}
+
+func unmarshalGroup(raw []byte) (*group, error) {
+	var g group
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// contentMessageID derives a stable message ID from message's topic and
+// payload, so the same logical record keeps the same wire ID across every
+// retransmit -- the envelope hash Transport.api.Post returns can't be used
+// for this since it's different on every send, which would both stop a
+// recipient from deduping repeated offers and stop an Ack from ever
+// matching a retransmitted record.
+func contentMessageID(message types.NewMessage) []byte {
+	h := sha256.New()
+	_, _ = h.Write(message.Topic[:])
+	_, _ = h.Write(message.Payload)
+	return h.Sum(nil)
+}
+
+// outgoingRecord is a payload pending acknowledgement.
+type outgoingRecord struct {
+	id       []byte // content-derived message ID, constant across retransmits
+	template types.NewMessage
+	retries  int
+}
+
+// Sender posts a fully-formed message (Payload already set to the wrapped
+// group) and returns the envelope hash it was sent under. It's a thin
+// wrapper around Transport.api.Post.
+type Sender func(message types.NewMessage) ([]byte, error)
+
+// DataSync tracks outgoing payloads, wraps them in group records (message ID
+// + offers + acks) and lets callers retransmit unacknowledged ones on
+// demand. Retransmission is meant to be driven by Transport subscribing to
+// the same EnvelopeEvent stream EnvelopesMonitor uses and calling Retransmit
+// when an envelope expires without being acked -- DataSync itself doesn't
+// run a blind timer for that, so nothing is resent unless there's actual
+// evidence the first attempt didn't land. Acks are the exception: they have
+// no envelope to watch, so they're flushed on a short interval.
+type DataSync struct {
+	logger *zap.Logger
+	sender Sender
+
+	mu      sync.Mutex
+	pending map[string]*outgoingRecord // keyed by string(contentMessageID)
+	acked   map[string]struct{}        // string(contentMessageID) of acked records
+
+	// envelopeToID maps the envelope hash a record was most recently sent
+	// under back to its content message ID, so Retransmit -- which is
+	// invoked with an envelope hash off the EnvelopeEvent stream -- can find
+	// the right pending entry even though that hash is different every time.
+	envelopeToID map[string]string
+
+	pendingAcks  map[string][][]byte         // keyed by string(topic)
+	ackTemplates map[string]types.NewMessage // keyed by string(topic): last template able to address it
+
+	ackTicker *time.Ticker
+	quit      chan struct{}
+}
+
+// New returns a DataSync that posts through sender.
+func New(logger *zap.Logger, sender Sender) *DataSync {
+	d := &DataSync{
+		logger:       logger.With(zap.Namespace("DataSync")),
+		sender:       sender,
+		pending:      make(map[string]*outgoingRecord),
+		acked:        make(map[string]struct{}),
+		envelopeToID: make(map[string]string),
+		pendingAcks:  make(map[string][][]byte),
+		ackTemplates: make(map[string]types.NewMessage),
+		ackTicker:    time.NewTicker(DefaultAckFlushInterval),
+		quit:         make(chan struct{}),
+	}
+	d.Start()
+	return d
+}
+
+// Start begins the ack-flushing loop. It must be called at most once; New
+// already calls it.
+func (d *DataSync) Start() {
+	go func() {
+		for {
+			select {
+			case <-d.quit:
+				d.ackTicker.Stop()
+				return
+			case <-d.ackTicker.C:
+				d.flushAcks()
+			}
+		}
+	}()
+}
+
+func (d *DataSync) Stop() {
+	close(d.quit)
+}
+
+// Track registers an already-sent envelope (envelopeHash is the hash the
+// Sender returned for it) so Retransmit can resend it if it's reported
+// expired before being acked. message's content derives the stable ID the
+// record keeps across every subsequent retransmit.
+func (d *DataSync) Track(envelopeHash []byte, message types.NewMessage) {
+	id := contentMessageID(message)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending[string(id)] = &outgoingRecord{id: id, template: message}
+	d.envelopeToID[string(envelopeHash)] = string(id)
+}
+
+// Ack marks messageID -- a content message ID, as carried in a group's Acks
+// -- as delivered so it stops being retransmitted.
+func (d *DataSync) Ack(messageID []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.acked[string(messageID)] = struct{}{}
+	delete(d.pending, string(messageID))
+}
+
+// QueueAck schedules an acknowledgement for messageID to be sent on
+// template's topic, piggy-backed on the next Retransmit for that topic or
+// flushed on its own within DefaultAckFlushInterval. template must be able
+// to address the topic on its own (SymKeyID/PublicKey/Topic/SigID already
+// set) since there may be no outgoing record left to borrow one from.
+func (d *DataSync) QueueAck(template types.NewMessage, messageID []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := string(template.Topic[:])
+	d.pendingAcks[key] = append(d.pendingAcks[key], messageID)
+	d.ackTemplates[key] = template
+}
+
+// Retransmit resends the record last sent under envelopeHash, piggy-backing
+// any acks queued for its topic, unless it's already been acked or has been
+// retried DefaultMaxRetries times. It's meant to be called from Transport's
+// EnvelopeEvent subscription on EventEnvelopeExpired, not from a timer, so a
+// record is only retransmitted once there's actual evidence the previous
+// attempt didn't reach its recipient(s).
+func (d *DataSync) Retransmit(envelopeHash []byte) error {
+	d.mu.Lock()
+	envelopeKey := string(envelopeHash)
+	idKey, ok := d.envelopeToID[envelopeKey]
+	delete(d.envelopeToID, envelopeKey)
+	if !ok {
+		d.mu.Unlock()
+		return nil // not a datasync envelope, or already retransmitted/acked
+	}
+
+	record, ok := d.pending[idKey]
+	if !ok {
+		d.mu.Unlock()
+		return nil // already acked
+	}
+	if record.retries >= DefaultMaxRetries {
+		delete(d.pending, idKey)
+		d.mu.Unlock()
+		d.logger.Warn("giving up on datasync record after max retries", zap.Binary("messageID", record.id))
+		return nil
+	}
+	record.retries++
+
+	topicKey := string(record.template.Topic[:])
+	acks := d.pendingAcks[topicKey]
+	delete(d.pendingAcks, topicKey)
+	d.mu.Unlock()
+
+	wrapped, err := marshalGroup(&group{
+		Offers: []offer{{MessageID: record.id, Payload: record.template.Payload}},
+		Acks:   acks,
+	})
+	if err != nil {
+		return err
+	}
+
+	message := record.template
+	message.Payload = wrapped
+
+	newHash, err := d.sender(message)
+	if err != nil {
+		d.mu.Lock()
+		d.envelopeToID[envelopeKey] = idKey
+		d.pendingAcks[topicKey] = append(acks, d.pendingAcks[topicKey]...)
+		d.mu.Unlock()
+		return err
+	}
+
+	// The retransmit got a new envelope hash; map it back to the same
+	// content ID so a later expiry for *that* attempt can trigger another
+	// retry, while the wire-visible message ID stays unchanged.
+	d.mu.Lock()
+	d.envelopeToID[string(newHash)] = idKey
+	d.mu.Unlock()
+
+	return nil
+}
+
+// flushAcks sends any acks that have been queued via QueueAck but not yet
+// piggy-backed on a Retransmit, addressed using the last template seen for
+// their topic.
+func (d *DataSync) flushAcks() {
+	d.mu.Lock()
+	pendingAcks := d.pendingAcks
+	d.pendingAcks = make(map[string][][]byte)
+	d.mu.Unlock()
+
+	for topicKey, acks := range pendingAcks {
+		if len(acks) == 0 {
+			continue
+		}
+
+		d.mu.Lock()
+		template, ok := d.ackTemplates[topicKey]
+		d.mu.Unlock()
+		if !ok {
+			d.logger.Warn("dropping acks for a topic with no known send template")
+			continue
+		}
+
+		wrapped, err := marshalGroup(&group{Acks: acks})
+		if err != nil {
+			d.logger.Error("failed to marshal ack-only datasync group", zap.Error(err))
+			continue
+		}
+
+		message := template
+		message.Payload = wrapped
+
+		if _, err := d.sender(message); err != nil {
+			d.logger.Warn("failed to send ack-only datasync group, will retry next tick", zap.Error(err))
+			d.mu.Lock()
+			d.pendingAcks[topicKey] = append(d.pendingAcks[topicKey], acks...)
+			d.mu.Unlock()
+		}
+	}
+}
+
+// Unwrap decodes a received group message, returning the inner payloads
+// (so callers know what to pass up to the next layer) alongside their
+// content message IDs, which should be queued with QueueAck so the sender
+// stops retransmitting them. ackedIDs carries the content message IDs the
+// remote peer is acknowledging, to be passed to Ack for any matching
+// outgoing records.
+func Unwrap(raw []byte) (payloads [][]byte, messageIDs [][]byte, ackedIDs [][]byte, err error) {
+	g, err := unmarshalGroup(raw)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, o := range g.Offers {
+		payloads = append(payloads, o.Payload)
+		messageIDs = append(messageIDs, o.MessageID)
+	}
+
+	return payloads, messageIDs, g.Acks, nil
+}
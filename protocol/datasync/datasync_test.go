@@ -0,0 +1,179 @@
+package datasync
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/status-im/status-go/eth-node/types"
+)
+
+// fakeSender records every message it's asked to send and returns a
+// deterministic, incrementing hash for it.
+type fakeSender struct {
+	mu       sync.Mutex
+	sent     []types.NewMessage
+	nextHash byte
+	fail     bool
+}
+
+func (f *fakeSender) send(message types.NewMessage) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return nil, errors.New("fake send failed")
+	}
+	f.sent = append(f.sent, message)
+	f.nextHash++
+	return []byte{f.nextHash}, nil
+}
+
+func newTestDataSync(sender *fakeSender) *DataSync {
+	d := New(zap.NewNop(), sender.send)
+	d.ackTicker.Stop() // tests flush acks explicitly instead of racing the ticker
+	return d
+}
+
+func TestMarshalUnmarshalGroupRoundtrip(t *testing.T) {
+	g := &group{
+		Offers: []offer{{MessageID: []byte("id-1"), Payload: []byte("payload-1")}},
+		Acks:   [][]byte{[]byte("id-0")},
+	}
+
+	raw, err := marshalGroup(g)
+	require.NoError(t, err)
+
+	payloads, messageIDs, ackedIDs, err := Unwrap(raw)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("payload-1")}, payloads)
+	require.Equal(t, [][]byte{[]byte("id-1")}, messageIDs)
+	require.Equal(t, [][]byte{[]byte("id-0")}, ackedIDs)
+}
+
+func TestRetransmitResendsTrackedRecord(t *testing.T) {
+	sender := &fakeSender{}
+	d := newTestDataSync(sender)
+
+	hash := []byte{1}
+	message := types.NewMessage{Payload: []byte("hello")}
+	d.Track(hash, message)
+
+	err := d.Retransmit(hash)
+	require.NoError(t, err)
+
+	sender.mu.Lock()
+	require.Len(t, sender.sent, 1)
+	sender.mu.Unlock()
+
+	_, _, _, err = Unwrap(sender.sent[0].Payload)
+	require.NoError(t, err)
+}
+
+func TestRetransmitKeepsMessageIDStableAcrossAttempts(t *testing.T) {
+	sender := &fakeSender{}
+	d := newTestDataSync(sender)
+
+	hash := []byte{100}
+	message := types.NewMessage{Payload: []byte("hello")}
+	d.Track(hash, message)
+
+	require.NoError(t, d.Retransmit(hash))
+	require.NoError(t, d.Retransmit([]byte{1})) // the envelope hash the first retransmit's send produced
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	require.Len(t, sender.sent, 2)
+
+	_, ids1, _, err := Unwrap(sender.sent[0].Payload)
+	require.NoError(t, err)
+	_, ids2, _, err := Unwrap(sender.sent[1].Payload)
+	require.NoError(t, err)
+
+	require.Equal(t, ids1, ids2, "the wire message ID must stay constant across retransmits of the same record")
+}
+
+func TestAckByContentIDStopsFurtherRetransmission(t *testing.T) {
+	sender := &fakeSender{}
+	d := newTestDataSync(sender)
+
+	hash := []byte{1}
+	message := types.NewMessage{Payload: []byte("hello")}
+	d.Track(hash, message)
+
+	require.NoError(t, d.Retransmit(hash))
+
+	sender.mu.Lock()
+	_, ids, _, err := Unwrap(sender.sent[0].Payload)
+	sender.mu.Unlock()
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+
+	// The peer acks using the content ID carried in the offer, not the
+	// envelope hash -- this is exactly what a remote peer does on receipt.
+	d.Ack(ids[0])
+
+	// A later expiry for the retransmitted envelope (hash []byte{1}, the
+	// first fakeSender-issued hash) must now be a no-op.
+	require.NoError(t, d.Retransmit([]byte{1}))
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	require.Len(t, sender.sent, 1, "an acked record must not be retransmitted again")
+}
+
+func TestRetransmitIsNoopForUnknownEnvelope(t *testing.T) {
+	sender := &fakeSender{}
+	d := newTestDataSync(sender)
+
+	err := d.Retransmit([]byte{99})
+	require.NoError(t, err)
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	require.Empty(t, sender.sent)
+}
+
+func TestRetransmitPiggyBacksQueuedAcks(t *testing.T) {
+	sender := &fakeSender{}
+	d := newTestDataSync(sender)
+
+	topic := types.TopicType{1, 2, 3, 4}
+	template := types.NewMessage{Topic: topic}
+
+	hash := []byte{1}
+	d.Track(hash, template)
+	d.QueueAck(template, []byte("acked-id"))
+
+	err := d.Retransmit(hash)
+	require.NoError(t, err)
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	require.Len(t, sender.sent, 1)
+
+	_, _, ackedIDs, err := Unwrap(sender.sent[0].Payload)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("acked-id")}, ackedIDs)
+}
+
+func TestFlushAcksDeliversQueuedAcksWithoutAnOffer(t *testing.T) {
+	sender := &fakeSender{}
+	d := newTestDataSync(sender)
+
+	topic := types.TopicType{5, 6, 7, 8}
+	template := types.NewMessage{Topic: topic}
+	d.QueueAck(template, []byte("acked-id"))
+
+	d.flushAcks()
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	require.Len(t, sender.sent, 1)
+
+	_, _, ackedIDs, err := Unwrap(sender.sent[0].Payload)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("acked-id")}, ackedIDs)
+}
@@ -0,0 +1,117 @@
+// Package messageprocessor composes encryption and optional datasync
+// retransmission into a single pipeline, modeled on the
+// message_processor.go from the old status-protocol-go: callers hand it an
+// already-encoded payload ([]byte) and a destination, and it takes care of
+// picking the right encryption (double ratchet / shared-secret /
+// partitioned topic), queueing behind datasync when enabled, and finally
+// posting through transport.Transport -- work that used to be scattered
+// across Messenger's send methods. It does not decode or encode
+// StatusMessages and applies no transit encoding of its own.
+package messageprocessor
+
+import (
+	"context"
+	"crypto/ecdsa"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/status-im/status-go/eth-node/types"
+	"github.com/status-im/status-go/protocol/transport"
+)
+
+// EncryptionProtocol is the subset of encryption.Protocol the processor
+// needs to turn a plaintext payload into wire-ready encrypted bytes.
+type EncryptionProtocol interface {
+	// BuildPublicMessage returns payload wrapped for a public channel.
+	BuildPublicMessage(myIdentityKey *ecdsa.PrivateKey, payload []byte) ([]byte, error)
+	// BuildDirectMessage selects (and negotiates, if needed) the double
+	// ratchet / shared-secret / partitioned-topic encryption for publicKey.
+	BuildDirectMessage(myIdentityKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, payload []byte) ([]byte, error)
+}
+
+type Option func(*MessageProcessor) error
+
+// WithDatasync routes messages sent with SendPublic through
+// transport.SendWithDatasync instead of transport.SendPublic, so they're
+// retransmitted until acked. SendPrivate is not affected by it.
+// The Transport passed to New must itself have been built with
+// transport.WithDatasyncNode, otherwise this is a no-op.
+func WithDatasync() Option {
+	return func(p *MessageProcessor) error {
+		p.datasyncEnabled = true
+		return nil
+	}
+}
+
+// MessageProcessor is the single entry point protocol.Messenger should send
+// outgoing messages through: it owns encryption and datasync so that
+// Transport stays a thin, encryption-agnostic transit layer.
+type MessageProcessor struct {
+	identity  *ecdsa.PrivateKey
+	encryptor EncryptionProtocol
+	transport *transport.Transport
+	logger    *zap.Logger
+
+	datasyncEnabled bool
+}
+
+// New returns a MessageProcessor that encrypts with encryptor and sends
+// through t.
+func New(identity *ecdsa.PrivateKey, encryptor EncryptionProtocol, t *transport.Transport, logger *zap.Logger, opts ...Option) (*MessageProcessor, error) {
+	p := &MessageProcessor{
+		identity:  identity,
+		encryptor: encryptor,
+		transport: t,
+		logger:    logger.With(zap.Namespace("MessageProcessor")),
+	}
+
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// SendPublic encrypts payload for chatName and posts it, going through
+// datasync if it's enabled.
+func (p *MessageProcessor) SendPublic(ctx context.Context, chatName string, payload []byte) ([]byte, error) {
+	encrypted, err := p.encryptor.BuildPublicMessage(p.identity, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt public message")
+	}
+
+	newMessage := &types.NewMessage{Payload: encrypted}
+
+	if !p.datasyncEnabled {
+		return p.transport.SendPublic(ctx, newMessage, chatName)
+	}
+
+	filter := p.transport.FilterByChatID(chatName)
+	if filter == nil {
+		var err error
+		filter, err = p.transport.JoinPublic(chatName)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to join public filter")
+		}
+	}
+
+	return p.transport.SendWithDatasync(ctx, newMessage, filter)
+}
+
+// SendPrivate encrypts payload for publicKey and posts it on the partitioned
+// topic. datasync is not yet wired up for private messages because the
+// partitioned filter is shared by all of a contact's installations, so a
+// per-installation ack scheme is needed first.
+func (p *MessageProcessor) SendPrivate(ctx context.Context, publicKey *ecdsa.PublicKey, payload []byte) ([]byte, error) {
+	encrypted, err := p.encryptor.BuildDirectMessage(p.identity, publicKey, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt private message")
+	}
+
+	newMessage := &types.NewMessage{Payload: encrypted}
+
+	return p.transport.SendPrivateWithPartitioned(ctx, newMessage, publicKey)
+}
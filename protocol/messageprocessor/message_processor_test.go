@@ -0,0 +1,26 @@
+package messageprocessor
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNewPropagatesOptionError(t *testing.T) {
+	optErr := errors.New("bad option")
+	failingOption := func(p *MessageProcessor) error {
+		return optErr
+	}
+
+	_, err := New(nil, nil, nil, zap.NewNop(), failingOption)
+
+	require.Equal(t, optErr, err)
+}
+
+func TestWithDatasyncEnablesFlag(t *testing.T) {
+	p, err := New(nil, nil, nil, zap.NewNop(), WithDatasync())
+	require.NoError(t, err)
+	require.True(t, p.datasyncEnabled)
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"github.com/status-im/status-go/protocol/common"
 	"github.com/status-im/status-go/protocol/encryption"
+	"github.com/status-im/status-go/protocol/messageprocessor"
 	"github.com/status-im/status-go/protocol/protobuf"
 	"github.com/status-im/status-go/protocol/push_notification_server"
 	"github.com/status-im/status-go/protocol/transport"
@@ -18,6 +19,11 @@ type config struct {
 	// DEPRECATED: no need to expose it
 	onSendContactCodeHandler func(*encryption.ProtocolMessageSpec)
 
+	// messageProcessor holds the processor set with WithMessageProcessor.
+	// It is only stored here: nothing in this package reads it, so no send
+	// path goes through it.
+	messageProcessor *messageprocessor.MessageProcessor
+
 	// systemMessagesTranslations holds translations for system-messages
 	systemMessagesTranslations map[protobuf.MembershipUpdateEvent_EventType]string
 	// Config for the envelopes monitor
@@ -111,3 +117,13 @@ func WithEnvelopesMonitorConfig(emc *transport.EnvelopesMonitorConfig) Option {
 		return nil
 	}
 }
+
+// WithMessageProcessor stores processor on the config. Nothing in this
+// package reads it, so setting it does not change how outgoing messages are
+// encrypted or posted.
+func WithMessageProcessor(processor *messageprocessor.MessageProcessor) Option {
+	return func(c *config) error {
+		c.messageProcessor = processor
+		return nil
+	}
+}
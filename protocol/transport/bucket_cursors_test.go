@@ -0,0 +1,32 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecodeBucketCursorsRoundtrip(t *testing.T) {
+	cursors := bucketCursors{
+		"community-1": []byte("cursor-a"),
+		"contacts":    []byte("cursor-b"),
+	}
+
+	raw, err := encodeBucketCursors(cursors)
+	require.NoError(t, err)
+
+	decoded, err := decodeBucketCursors(raw)
+	require.NoError(t, err)
+	require.Equal(t, cursors, decoded)
+}
+
+func TestDecodeBucketCursorsEmptyInput(t *testing.T) {
+	decoded, err := decodeBucketCursors(nil)
+	require.NoError(t, err)
+	require.Equal(t, bucketCursors{}, decoded)
+}
+
+func TestDecodeBucketCursorsInvalidJSON(t *testing.T) {
+	_, err := decodeBucketCursors([]byte("not json"))
+	require.Error(t, err)
+}
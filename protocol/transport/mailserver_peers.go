@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultMailserverRequestTimeout is how long we wait for a single peer to
+// answer EventMailServerRequestCompleted before rotating to the next one.
+const defaultMailserverRequestTimeout = 10 * time.Second
+
+// mailserverPeerStats tracks the observed behaviour of a single mailserver
+// peer so that healthier peers can be preferred on subsequent requests.
+type mailserverPeerStats struct {
+	successCount  int
+	failureCount  int
+	totalLatency  time.Duration
+	lastRequestAt time.Time
+}
+
+// untriedPeerScore is assigned to a peer we've never sent a request to. It's
+// deliberately worse than a typical proven-healthy peer's score (so a peer
+// with an actual track record of success is preferred over a guess) but
+// better than even a single observed failure, so untried peers still get a
+// turn ahead of ones already known to be flaky. Without this, a 0 score for
+// untried peers would rank them ahead of every peer we've successfully used
+// before, and orderedPeers would keep exploring instead of converging on the
+// healthiest peer.
+const untriedPeerScore = float64(500 * time.Millisecond)
+
+// score ranks a peer lower (better) the fewer failures and the lower the
+// average latency it has accumulated.
+func (s *mailserverPeerStats) score() float64 {
+	if s.successCount == 0 && s.failureCount == 0 {
+		return untriedPeerScore
+	}
+	avgLatency := float64(0)
+	if s.successCount > 0 {
+		avgLatency = float64(s.totalLatency) / float64(s.successCount)
+	}
+	// Each failure is penalised as if it added a second of latency on top
+	// of whatever we've already observed, so that a single slow-but-working
+	// peer is still preferred over one that keeps failing.
+	return avgLatency + float64(s.failureCount)*float64(time.Second)
+}
+
+// mailserverPeerPool tracks the set of configured mailserver peers and
+// orders them by observed health so that SendMessagesRequest can fail over
+// from one to the next instead of blocking on a single peer.
+type mailserverPeerPool struct {
+	mu    sync.Mutex
+	peers []string
+	stats map[string]*mailserverPeerStats
+}
+
+func newMailserverPeerPool(peers []string) *mailserverPeerPool {
+	stats := make(map[string]*mailserverPeerStats, len(peers))
+	for _, p := range peers {
+		stats[p] = &mailserverPeerStats{}
+	}
+	return &mailserverPeerPool{
+		peers: peers,
+		stats: stats,
+	}
+}
+
+// orderedPeers returns the configured peers sorted from healthiest to least
+// healthy, based on past latency and failure counts.
+func (p *mailserverPeerPool) orderedPeers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ordered := make([]string, len(p.peers))
+	copy(ordered, p.peers)
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return p.statsFor(ordered[i]).score() < p.statsFor(ordered[j]).score()
+	})
+
+	return ordered
+}
+
+// statsFor must be called with p.mu held.
+func (p *mailserverPeerPool) statsFor(peer string) *mailserverPeerStats {
+	s, ok := p.stats[peer]
+	if !ok {
+		s = &mailserverPeerStats{}
+		p.stats[peer] = s
+	}
+	return s
+}
+
+func (p *mailserverPeerPool) recordSuccess(peer string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.statsFor(peer)
+	s.successCount++
+	s.totalLatency += latency
+	s.lastRequestAt = time.Now()
+}
+
+func (p *mailserverPeerPool) recordFailure(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.statsFor(peer)
+	s.failureCount++
+	s.lastRequestAt = time.Now()
+}
+
+func (p *mailserverPeerPool) isEmpty() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.peers) == 0
+}
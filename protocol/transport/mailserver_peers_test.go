@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedPeersPrefersProvenHealthyOverUntried(t *testing.T) {
+	pool := newMailserverPeerPool([]string{"healthy", "untried", "failing"})
+
+	pool.recordSuccess("healthy", 50*time.Millisecond)
+	pool.recordFailure("failing")
+
+	ordered := pool.orderedPeers()
+
+	require.Equal(t, []string{"healthy", "untried", "failing"}, ordered)
+}
+
+func TestOrderedPeersPrefersLowerLatency(t *testing.T) {
+	pool := newMailserverPeerPool([]string{"slow", "fast"})
+
+	pool.recordSuccess("slow", 2*time.Second)
+	pool.recordSuccess("fast", 10*time.Millisecond)
+
+	ordered := pool.orderedPeers()
+
+	require.Equal(t, []string{"fast", "slow"}, ordered)
+}
+
+func TestOrderedPeersPenalisesFailures(t *testing.T) {
+	pool := newMailserverPeerPool([]string{"a", "b"})
+
+	pool.recordSuccess("a", 100*time.Millisecond)
+	pool.recordFailure("a")
+	pool.recordSuccess("b", 900*time.Millisecond)
+
+	ordered := pool.orderedPeers()
+
+	require.Equal(t, []string{"b", "a"}, ordered)
+}
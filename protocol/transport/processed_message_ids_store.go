@@ -0,0 +1,234 @@
+package transport
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ProcessedMessageIDsStore is implemented by anything that can remember
+// which message IDs have already been processed, so RetrieveRawAll can skip
+// delivering them to the upper layers twice. NewProcessedMessageIDsCache's
+// sqlite-backed cache satisfies this already; rollingBloomStore below is a
+// second, in-memory implementation for high-throughput deployments where an
+// SQL roundtrip per poll is too slow.
+type ProcessedMessageIDsStore interface {
+	Add(ids []string, timestamp uint64) error
+	Hits(ids []string) (map[string]bool, error)
+	Clean(timestamp uint64) error
+}
+
+var _ ProcessedMessageIDsStore = (*ProcessedMessageIDsCache)(nil)
+
+// ProcessedMessageIDsWarmer is implemented by a ProcessedMessageIDsStore that
+// can enumerate everything it currently holds, so NewRollingBloomStore can
+// seed its in-memory Bloom filter from it at construction time instead of
+// starting every process restart with an empty filter (which would make
+// every previously-processed ID look new again until the filter refills).
+// ProcessedMessageIDsCache doesn't implement this. Without warming, an ID
+// processed before the restart is a Bloom-negative, and rollingBloomStore's
+// Hits reports it as not processed without consulting durable.
+type ProcessedMessageIDsWarmer interface {
+	AllIDs() ([]string, error)
+}
+
+// DefaultProcessedMessageIDsTTL is how far back ConfirmMessagesProcessed
+// entries are kept before cleanFiltersLoop evicts them, when no explicit TTL
+// is configured via WithProcessedMessageTTL.
+const DefaultProcessedMessageIDsTTL = 30 * 24 * time.Hour
+
+// bloomGeneration is a fixed-size Bloom filter for message ID membership
+// tests. It never forgets within its own lifetime; eviction happens by
+// rolling over to a fresh generation (see rollingBloomStore).
+type bloomGeneration struct {
+	bits []uint64
+	k    uint
+}
+
+// newBloomGeneration sizes the filter for expectedItems at ~1% false
+// positive rate using the standard m = -n*ln(p)/(ln(2)^2), k = (m/n)*ln(2)
+// formulas.
+func newBloomGeneration(expectedItems uint) *bloomGeneration {
+	if expectedItems == 0 {
+		expectedItems = 1
+	}
+	const falsePositiveRate = 0.01
+	m := uint(float64(expectedItems) * 9.6) // ~ -n*ln(0.01)/(ln2)^2
+	if m == 0 {
+		m = 64
+	}
+	words := (m + 63) / 64
+	k := uint(float64(words*64) / float64(expectedItems) * 0.693)
+	if k == 0 {
+		k = 1
+	}
+	return &bloomGeneration{
+		bits: make([]uint64, words),
+		k:    k,
+	}
+}
+
+func (b *bloomGeneration) hashes(id string) (h1, h2 uint64) {
+	f1 := fnv.New64a()
+	_, _ = f1.Write([]byte(id))
+	h1 = f1.Sum64()
+
+	f2 := fnv.New64()
+	_, _ = f2.Write([]byte(id))
+	h2 = f2.Sum64()
+
+	return h1, h2
+}
+
+func (b *bloomGeneration) bitIndex(h1, h2 uint64, i uint) uint64 {
+	combined := h1 + uint64(i)*h2
+	return combined % uint64(len(b.bits)*64)
+}
+
+func (b *bloomGeneration) add(id string) {
+	h1, h2 := b.hashes(id)
+	for i := uint(0); i < b.k; i++ {
+		idx := b.bitIndex(h1, h2, i)
+		b.bits[idx/64] |= 1 << (idx % 64)
+	}
+}
+
+func (b *bloomGeneration) test(id string) bool {
+	h1, h2 := b.hashes(id)
+	for i := uint(0); i < b.k; i++ {
+		idx := b.bitIndex(h1, h2, i)
+		if b.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// rollingBloomStore is an in-memory ProcessedMessageIDsStore sized for
+// expected throughput: ids are tested against two Bloom filter generations
+// (current and previous) instead of the O(messages) SQL roundtrips
+// NewProcessedMessageIDsCache does on every poll. Every Add is also written
+// through to durable for persistence across restarts.
+//
+// Because a Bloom filter can't enumerate what it contains, Clean can't
+// selectively evict individual expired IDs; instead the whole "previous"
+// generation is dropped and "current" rolls down into its place every TTL,
+// which is what bounds memory use and approximates time-based eviction.
+type rollingBloomStore struct {
+	mu       sync.Mutex
+	expected uint
+	current  *bloomGeneration
+	previous *bloomGeneration
+	rolledAt time.Time
+	ttl      time.Duration
+	durable  ProcessedMessageIDsStore
+}
+
+// NewRollingBloomStore returns a ProcessedMessageIDsStore that answers Hits
+// from memory, falling back to durable to confirm Bloom-positives and reject
+// false positives, and writes Add through to durable. expectedItems sizes the
+// Bloom filter for the throughput the caller expects per ttl window. If
+// durable implements ProcessedMessageIDsWarmer, its IDs are loaded into the
+// filter up front so a process restart doesn't cause every message durable
+// already knows about to look new again.
+func NewRollingBloomStore(expectedItems uint, ttl time.Duration, durable ProcessedMessageIDsStore) (ProcessedMessageIDsStore, error) {
+	if ttl <= 0 {
+		ttl = DefaultProcessedMessageIDsTTL
+	}
+	s := &rollingBloomStore{
+		expected: expectedItems,
+		current:  newBloomGeneration(expectedItems),
+		previous: newBloomGeneration(expectedItems),
+		rolledAt: time.Now(),
+		ttl:      ttl,
+		durable:  durable,
+	}
+
+	if warmer, ok := durable.(ProcessedMessageIDsWarmer); ok {
+		ids, err := warmer.AllIDs()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to warm rolling bloom store")
+		}
+		for _, id := range ids {
+			s.current.add(id)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *rollingBloomStore) Add(ids []string, timestamp uint64) error {
+	s.mu.Lock()
+	for _, id := range ids {
+		s.current.add(id)
+	}
+	s.mu.Unlock()
+
+	if s.durable != nil {
+		return s.durable.Add(ids, timestamp)
+	}
+	return nil
+}
+
+// Hits trusts a Bloom-negative as a definite "never processed" (a Bloom
+// filter never false-negatives), but a Bloom-positive is only a maybe: at
+// the filter's ~1% false positive rate, treating it as certain would
+// silently drop genuinely new messages. So every positive is confirmed
+// against durable before being reported as a hit; if durable is nil there's
+// nothing to confirm against, so positives are trusted as a best effort.
+func (s *rollingBloomStore) Hits(ids []string) (map[string]bool, error) {
+	s.mu.Lock()
+	hits := make(map[string]bool, len(ids))
+	var maybe []string
+	for _, id := range ids {
+		if s.current.test(id) || s.previous.test(id) {
+			maybe = append(maybe, id)
+		} else {
+			hits[id] = false
+		}
+	}
+	s.mu.Unlock()
+
+	if len(maybe) == 0 {
+		return hits, nil
+	}
+
+	if s.durable == nil {
+		for _, id := range maybe {
+			hits[id] = true
+		}
+		return hits, nil
+	}
+
+	confirmed, err := s.durable.Hits(maybe)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range maybe {
+		hits[id] = confirmed[id]
+	}
+
+	return hits, nil
+}
+
+// Clean rolls the Bloom generations over if ttl has elapsed since the last
+// roll, and forwards to durable so any on-disk store keeps its own
+// timestamp-based eviction. timestamp is only used by durable: the Bloom
+// side has no concept of "processed before timestamp", only "processed in
+// this generation or the previous one".
+func (s *rollingBloomStore) Clean(timestamp uint64) error {
+	s.mu.Lock()
+	if time.Since(s.rolledAt) >= s.ttl {
+		s.previous = s.current
+		s.current = newBloomGeneration(s.expected)
+		s.rolledAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	if s.durable != nil {
+		return s.durable.Clean(timestamp)
+	}
+	return nil
+}
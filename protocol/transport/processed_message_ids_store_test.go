@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDurableStore is a minimal in-memory ProcessedMessageIDsStore standing
+// in for the sqlite-backed ProcessedMessageIDsCache in tests.
+type fakeDurableStore struct {
+	ids map[string]bool
+}
+
+func newFakeDurableStore(ids ...string) *fakeDurableStore {
+	f := &fakeDurableStore{ids: make(map[string]bool)}
+	for _, id := range ids {
+		f.ids[id] = true
+	}
+	return f
+}
+
+func (f *fakeDurableStore) Add(ids []string, timestamp uint64) error {
+	for _, id := range ids {
+		f.ids[id] = true
+	}
+	return nil
+}
+
+func (f *fakeDurableStore) Hits(ids []string) (map[string]bool, error) {
+	hits := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		hits[id] = f.ids[id]
+	}
+	return hits, nil
+}
+
+func (f *fakeDurableStore) Clean(timestamp uint64) error {
+	return nil
+}
+
+// fakeWarmableDurableStore additionally implements ProcessedMessageIDsWarmer.
+type fakeWarmableDurableStore struct {
+	*fakeDurableStore
+}
+
+func (f *fakeWarmableDurableStore) AllIDs() ([]string, error) {
+	ids := make([]string, 0, len(f.ids))
+	for id := range f.ids {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func TestHitsTrustsBloomNegativeWithoutConsultingDurable(t *testing.T) {
+	// durable knows the ID but the Bloom filter doesn't (fakeDurableStore
+	// can't warm it), so a hit here would mean durable had been consulted.
+	durable := newFakeDurableStore("never-added")
+	store, err := NewRollingBloomStore(100, time.Hour, durable)
+	require.NoError(t, err)
+
+	hits, err := store.Hits([]string{"never-added"})
+	require.NoError(t, err)
+	require.False(t, hits["never-added"])
+}
+
+func TestHitsConfirmsBloomPositiveAgainstDurable(t *testing.T) {
+	durable := newFakeDurableStore()
+	store, err := NewRollingBloomStore(100, time.Hour, durable)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Add([]string{"seen-id"}, 1))
+
+	// durable says "seen-id" really was processed: a true Bloom positive.
+	hits, err := store.Hits([]string{"seen-id"})
+	require.NoError(t, err)
+	require.True(t, hits["seen-id"])
+}
+
+func TestHitsRejectsBloomFalsePositiveUsingDurable(t *testing.T) {
+	durable := newFakeDurableStore()
+	store, err := NewRollingBloomStore(100, time.Hour, durable)
+	require.NoError(t, err)
+
+	rbs := store.(*rollingBloomStore)
+	// Force a Bloom-positive for an ID that was never actually processed,
+	// simulating the ~1% false positive rate, without durable knowing about it.
+	rbs.current.add("false-positive-id")
+
+	hits, err := store.Hits([]string{"false-positive-id"})
+	require.NoError(t, err)
+	require.False(t, hits["false-positive-id"], "durable should have corrected the bloom false positive")
+}
+
+func TestNewRollingBloomStoreWarmsFromDurable(t *testing.T) {
+	durable := &fakeWarmableDurableStore{fakeDurableStore: newFakeDurableStore("pre-existing-id")}
+
+	store, err := NewRollingBloomStore(100, time.Hour, durable)
+	require.NoError(t, err)
+
+	// Without a warm-at-construction fix, a restart would make a
+	// durable-known ID look new again because the in-memory filter starts
+	// empty and a Bloom-negative is never checked against durable; warming
+	// makes it a Bloom-positive, which durable then confirms.
+	hits, err := store.Hits([]string{"pre-existing-id"})
+	require.NoError(t, err)
+	require.True(t, hits["pre-existing-id"])
+}
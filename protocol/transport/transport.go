@@ -6,6 +6,7 @@ import (
 	"crypto/ecdsa"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"math/big"
 	"sync"
 	"time"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/status-im/status-go/eth-node/crypto"
 	"github.com/status-im/status-go/eth-node/types"
+	"github.com/status-im/status-go/protocol/datasync"
 )
 
 var (
@@ -62,6 +64,86 @@ func (m *transportKeysManager) RawSymKey(id string) ([]byte, error) {
 
 type Option func(*Transport) error
 
+// WithDatasyncNode enables the datasync retransmission layer for messages
+// sent through SendWithDatasync. Retransmits are posted through node's
+// PublicWakuAPI rather than the Transport's own waku, which lets tests and
+// light clients drive retransmission through a node other than the one used
+// for the rest of the transport. Unacknowledged records are retransmitted
+// when node reports their envelope as expired, the same EnvelopeEvent stream
+// EnvelopesMonitor watches, rather than on a fixed timer.
+func WithDatasyncNode(node types.Waku) Option {
+	return func(t *Transport) error {
+		sender := func(message types.NewMessage) ([]byte, error) {
+			return node.PublicWakuAPI().Post(context.Background(), message)
+		}
+		t.dataSync = datasync.New(t.logger, sender)
+		t.watchDatasyncEnvelopes(node)
+		return nil
+	}
+}
+
+// watchDatasyncEnvelopes retransmits any tracked datasync record whose
+// envelope expired without being acknowledged. It runs until t.quit is
+// closed, same as cleanFiltersLoop.
+func (t *Transport) watchDatasyncEnvelopes(node types.Waku) {
+	events := make(chan types.EnvelopeEvent, 100)
+	sub := node.SubscribeEnvelopeEvents(events)
+
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-t.quit:
+				return
+			case ev := <-events:
+				if ev.Event != types.EventEnvelopeExpired {
+					continue
+				}
+				if err := t.dataSync.Retransmit(ev.Hash.Bytes()); err != nil {
+					t.logger.Error("failed to retransmit datasync record", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// TopicBucketPolicy groups the registered filters into named buckets that
+// should each be queried with their own bloom filter, instead of ORing every
+// filter's topic into one request. Buckets are commonly split along chat
+// boundaries (one per community, one for 1:1 contacts, one for the
+// remaining public channels) so that a single mailserver request doesn't
+// reveal the topics of every chat a user is in.
+type TopicBucketPolicy func(filters []*Filter) map[string][]*Filter
+
+// WithMailserverTopicBuckets configures how SendMessagesRequestBucketed
+// splits the registered filters before querying mailservers.
+func WithMailserverTopicBuckets(policy TopicBucketPolicy) Option {
+	return func(t *Transport) error {
+		t.topicBucketPolicy = policy
+		return nil
+	}
+}
+
+// WithProcessedMessageCache overrides the default sqlite-backed
+// ProcessedMessageIDsCache with store, e.g. NewRollingBloomStore for
+// deployments where an SQL roundtrip per RetrieveRawAll poll is too slow.
+func WithProcessedMessageCache(store ProcessedMessageIDsStore) Option {
+	return func(t *Transport) error {
+		t.cache = store
+		return nil
+	}
+}
+
+// WithProcessedMessageTTL overrides DefaultProcessedMessageIDsTTL, the age
+// at which cleanFiltersLoop evicts entries from the processed message
+// cache.
+func WithProcessedMessageTTL(ttl time.Duration) Option {
+	return func(t *Transport) error {
+		t.processedMessagesTTL = ttl
+		return nil
+	}
+}
+
 // Transport is a transport based on Whisper service.
 type Transport struct {
 	waku        types.Waku
@@ -69,17 +151,22 @@ type Transport struct {
 	keysManager *transportKeysManager
 	filters     *FiltersManager
 	logger      *zap.Logger
-	cache       *ProcessedMessageIDsCache
+	cache       ProcessedMessageIDsStore
 
-	mailservers      []string
-	envelopesMonitor *EnvelopesMonitor
-	quit             chan struct{}
+	mailservers          []string
+	mailserverPeers      *mailserverPeerPool
+	topicBucketPolicy    TopicBucketPolicy
+	envelopesMonitor     *EnvelopesMonitor
+	dataSync             *datasync.DataSync
+	processedMessagesTTL time.Duration
+	quit                 chan struct{}
 }
 
 // NewTransport returns a new Transport.
 // TODO: leaving a chat should verify that for a given public key
-//       there are no other chats. It may happen that we leave a private chat
-//       but still have a public chat for a given public key.
+//
+//	there are no other chats. It may happen that we leave a private chat
+//	but still have a public chat for a given public key.
 func NewTransport(
 	waku types.Waku,
 	privateKey *ecdsa.PrivateKey,
@@ -115,9 +202,11 @@ func NewTransport(
 			privateKey:        privateKey,
 			passToSymKeyCache: make(map[string]string),
 		},
-		filters:     filtersManager,
-		mailservers: mailservers,
-		logger:      logger.With(zap.Namespace("Transport")),
+		filters:              filtersManager,
+		mailservers:          mailservers,
+		mailserverPeers:      newMailserverPeerPool(mailservers),
+		processedMessagesTTL: DefaultProcessedMessageIDsTTL,
+		logger:               logger.With(zap.Namespace("Transport")),
 	}
 
 	for _, opt := range opts {
@@ -251,8 +340,43 @@ func (t *Transport) RetrieveRawAll() (map[Filter][]*types.Message, error) {
 
 		for i := range msgs {
 			// Exclude anything that is a cache hit
-			if !hits[types.EncodeHex(msgs[i].Hash)] {
+			if hits[types.EncodeHex(msgs[i].Hash)] {
+				continue
+			}
+
+			if t.dataSync == nil {
+				result[*filter] = append(result[*filter], msgs[i])
+				continue
+			}
+
+			payloads, messageIDs, ackedIDs, err := datasync.Unwrap(msgs[i].Payload)
+			if err != nil || (len(payloads) == 0 && len(ackedIDs) == 0) {
+				// Not every payload is necessarily a datasync group (e.g.
+				// messages sent before datasync was enabled, or a plain
+				// application payload that happens to unmarshal into an
+				// empty group), so fall back to passing it through
+				// unchanged rather than silently dropping it.
 				result[*filter] = append(result[*filter], msgs[i])
+				continue
+			}
+
+			for _, ackedID := range ackedIDs {
+				t.dataSync.Ack(ackedID)
+			}
+
+			ackTemplate := types.NewMessage{
+				SymKeyID: filter.SymKeyID,
+				Topic:    filter.Topic,
+			}
+			if err := t.addSig(&ackTemplate); err != nil {
+				t.logger.Error("failed to sign datasync ack template", zap.Error(err))
+			}
+
+			for j, payload := range payloads {
+				t.dataSync.QueueAck(ackTemplate, messageIDs[j])
+				unwrapped := *msgs[i]
+				unwrapped.Payload = payload
+				result[*filter] = append(result[*filter], &unwrapped)
 			}
 		}
 
@@ -355,6 +479,32 @@ func (t *Transport) SendCommunityMessage(ctx context.Context, newMessage *types.
 	return t.api.Post(ctx, *newMessage)
 }
 
+// SendWithDatasync posts newMessage exactly like the other Send* methods,
+// but additionally tracks the envelope hash it was posted under so that,
+// once WithDatasyncNode is configured, watchDatasyncEnvelopes retransmits it
+// if that envelope expires without being acknowledged. The returned hash is
+// always the real envelope hash api.Post produced, so callers (e.g. Track)
+// can key off it exactly as they do for the other Send* methods.
+func (t *Transport) SendWithDatasync(ctx context.Context, newMessage *types.NewMessage, filter *Filter) ([]byte, error) {
+	if err := t.addSig(newMessage); err != nil {
+		return nil, err
+	}
+
+	newMessage.SymKeyID = filter.SymKeyID
+	newMessage.Topic = filter.Topic
+
+	hash, err := t.api.Post(ctx, *newMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.dataSync != nil {
+		t.dataSync.Track(hash, *newMessage)
+	}
+
+	return hash, nil
+}
+
 func (t *Transport) cleanFilters() error {
 	return t.filters.RemoveNoListenFilters()
 }
@@ -388,6 +538,9 @@ func (t *Transport) Stop() error {
 	if t.envelopesMonitor != nil {
 		t.envelopesMonitor.Stop()
 	}
+	if t.dataSync != nil {
+		t.dataSync.Stop()
+	}
 	return nil
 }
 
@@ -411,6 +564,11 @@ func (t *Transport) cleanFiltersLoop() {
 				if err != nil {
 					t.logger.Error("failed to clean up topics", zap.Error(err))
 				}
+
+				cutoff := uint64(time.Now().Add(-t.processedMessagesTTL).UnixNano() / int64(time.Millisecond))
+				if err := t.cache.Clean(cutoff); err != nil {
+					t.logger.Error("failed to clean up processed message cache", zap.Error(err))
+				}
 			}
 		}
 	}()
@@ -450,7 +608,53 @@ func (t *Transport) sendMessagesRequestForTopics(
 	return
 }
 
-// RequestHistoricMessages requests historic messages for all registered filters.
+// sendMessagesRequestWithFailover walks the configured mailserver peers from
+// healthiest to least healthy, issuing the request to one peer at a time and
+// bailing out to the next as soon as one fails or does not answer
+// EventMailServerRequestCompleted within defaultMailserverRequestTimeout.
+// Per-peer latency and failure counts are recorded on t.mailserverPeers so
+// that the healthiest peer is tried first on the next call.
+func (t *Transport) sendMessagesRequestWithFailover(
+	ctx context.Context,
+	from, to uint32,
+	previousCursor []byte,
+	topics []types.TopicType,
+	waitForResponse bool,
+) (cursor []byte, err error) {
+	if t.mailserverPeers.isEmpty() {
+		return nil, ErrNoMailservers
+	}
+
+	peers := t.mailserverPeers.orderedPeers()
+
+	for i, peer := range peers {
+		peerCtx, cancel := context.WithTimeout(ctx, defaultMailserverRequestTimeout)
+		start := t.waku.GetCurrentTime()
+
+		cursor, err = t.sendMessagesRequestForTopics(peerCtx, types.DecodeHex(peer), from, to, previousCursor, topics, waitForResponse)
+		cancel()
+
+		if err == nil {
+			t.mailserverPeers.recordSuccess(peer, t.waku.GetCurrentTime().Sub(start))
+			return cursor, nil
+		}
+
+		t.mailserverPeers.recordFailure(peer)
+		t.logger.Warn("mailserver request failed, failing over to next peer",
+			zap.String("peer", peer),
+			zap.Int("attempt", i+1),
+			zap.Int("peersLeft", len(peers)-i-1),
+			zap.Error(err),
+		)
+	}
+
+	return nil, err
+}
+
+// SendMessagesRequest requests historic messages for all registered filters.
+// If peerID is given, the request goes to that peer alone, exactly as
+// before; pass nil to have it fail over across the configured mailservers
+// until one of them answers.
 func (t *Transport) SendMessagesRequest(
 	ctx context.Context,
 	peerID []byte,
@@ -459,14 +663,20 @@ func (t *Transport) SendMessagesRequest(
 	waitForResponse bool,
 ) (cursor []byte, err error) {
 
-	topics := make([]types.TopicType, len(t.Filters()))
+	topics := make([]types.TopicType, 0, len(t.Filters()))
 	for _, f := range t.Filters() {
 		topics = append(topics, f.Topic)
 	}
 
-	return t.sendMessagesRequestForTopics(ctx, peerID, from, to, previousCursor, topics, waitForResponse)
+	if len(peerID) > 0 {
+		return t.sendMessagesRequestForTopics(ctx, peerID, from, to, previousCursor, topics, waitForResponse)
+	}
+
+	return t.sendMessagesRequestWithFailover(ctx, from, to, previousCursor, topics, waitForResponse)
 }
 
+// SendMessagesRequestForFilter behaves like SendMessagesRequest but only
+// requests filter's topic.
 func (t *Transport) SendMessagesRequestForFilter(
 	ctx context.Context,
 	peerID []byte,
@@ -476,10 +686,172 @@ func (t *Transport) SendMessagesRequestForFilter(
 	waitForResponse bool,
 ) (cursor []byte, err error) {
 
-	topics := make([]types.TopicType, len(t.Filters()))
-	topics = append(topics, filter.Topic)
+	topics := []types.TopicType{filter.Topic}
+
+	if len(peerID) > 0 {
+		return t.sendMessagesRequestForTopics(ctx, peerID, from, to, previousCursor, topics, waitForResponse)
+	}
+
+	return t.sendMessagesRequestWithFailover(ctx, from, to, previousCursor, topics, waitForResponse)
+}
+
+// bucketCursors is the wire format for the merged cursor
+// SendMessagesRequestBucketed returns: one cursor per bucket, so each bucket
+// can be paginated independently of the others.
+type bucketCursors map[string][]byte
+
+func encodeBucketCursors(c bucketCursors) ([]byte, error) {
+	return json.Marshal(c)
+}
+
+func decodeBucketCursors(raw []byte) (bucketCursors, error) {
+	if len(raw) == 0 {
+		return bucketCursors{}, nil
+	}
+	var c bucketCursors
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SendMessagesRequestBucketed splits the registered filters into buckets
+// according to the configured TopicBucketPolicy and issues one
+// MessagesRequest per bucket concurrently, each with its own bloom filter,
+// instead of ORing every filter's topic into a single request. This keeps a
+// single request from leaking metadata about all of a user's chats to the
+// mailserver, and stops the bucket's bloom filter from being diluted by
+// topics the caller isn't asking for in that request.
+//
+// previousCursor and the returned cursor are opaque, JSON-encoded per-bucket
+// cursor maps produced by this method; pass back exactly what was returned
+// to resume every bucket where it left off. If no TopicBucketPolicy was
+// configured, this falls back to SendMessagesRequest's single-bucket
+// behaviour.
+func (t *Transport) SendMessagesRequestBucketed(
+	ctx context.Context,
+	from, to uint32,
+	previousCursor []byte,
+	waitForResponse bool,
+) ([]byte, error) {
+	if t.topicBucketPolicy == nil {
+		return t.SendMessagesRequest(ctx, nil, from, to, previousCursor, waitForResponse)
+	}
+
+	prevCursors, err := decodeBucketCursors(previousCursor)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode previous cursor")
+	}
+
+	buckets := t.topicBucketPolicy(t.Filters())
+
+	type bucketResult struct {
+		name   string
+		cursor []byte
+		err    error
+	}
+
+	results := make(chan bucketResult, len(buckets))
+	for name, filters := range buckets {
+		name, filters := name, filters
+		go func() {
+			topics := make([]types.TopicType, 0, len(filters))
+			for _, f := range filters {
+				topics = append(topics, f.Topic)
+			}
+			cursor, err := t.sendMessagesRequestWithFailover(ctx, from, to, prevCursors[name], topics, waitForResponse)
+			results <- bucketResult{name: name, cursor: cursor, err: err}
+		}()
+	}
+
+	nextCursors := make(bucketCursors, len(buckets))
+	var firstErr error
+	for range buckets {
+		res := <-results
+		if res.err != nil {
+			t.logger.Warn("bucketed mailserver request failed", zap.String("bucket", res.name), zap.Error(res.err))
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		if len(res.cursor) > 0 {
+			nextCursors[res.name] = res.cursor
+		}
+	}
+
+	merged, err := encodeBucketCursors(nextCursors)
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, firstErr
+}
+
+// FanoutMessagesRequest issues the same MessagesRequest to up to fanout of
+// the configured mailserver peers concurrently and returns the first
+// successful response, ignoring the rest. It's meant for cases where
+// latency matters more than load on the mailservers, e.g. catching up after
+// being offline. Peer health is recorded exactly as it is for
+// SendMessagesRequest so the ordering keeps improving over time regardless
+// of which mode callers use.
+func (t *Transport) FanoutMessagesRequest(
+	ctx context.Context,
+	from, to uint32,
+	previousCursor []byte,
+	fanout int,
+) (cursor []byte, err error) {
+	if fanout <= 0 {
+		return nil, errors.New("fanout must be a positive number of peers")
+	}
+	if t.mailserverPeers.isEmpty() {
+		return nil, ErrNoMailservers
+	}
+
+	topics := make([]types.TopicType, 0, len(t.Filters()))
+	for _, f := range t.Filters() {
+		topics = append(topics, f.Topic)
+	}
+
+	peers := t.mailserverPeers.orderedPeers()
+	if fanout > len(peers) {
+		fanout = len(peers)
+	}
+	peers = peers[:fanout]
+
+	fanoutCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		peer   string
+		cursor []byte
+		err    error
+		took   time.Duration
+	}
+
+	results := make(chan result, len(peers))
+	for _, peer := range peers {
+		peer := peer
+		go func() {
+			start := t.waku.GetCurrentTime()
+			c, err := t.sendMessagesRequestForTopics(fanoutCtx, types.DecodeHex(peer), from, to, previousCursor, topics, true)
+			results <- result{peer: peer, cursor: c, err: err, took: t.waku.GetCurrentTime().Sub(start)}
+		}()
+	}
+
+	var lastErr error
+	for range peers {
+		res := <-results
+		if res.err != nil {
+			t.mailserverPeers.recordFailure(res.peer)
+			lastErr = res.err
+			continue
+		}
+		t.mailserverPeers.recordSuccess(res.peer, res.took)
+		return res.cursor, nil
+	}
 
-	return t.sendMessagesRequestForTopics(ctx, peerID, from, to, previousCursor, topics, waitForResponse)
+	return nil, lastErr
 }
 
 func createMessagesRequest(from, to uint32, cursor []byte, topics []types.TopicType) types.MessagesRequest {